@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"fmt"
 	"html/template"
@@ -12,7 +13,12 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/ledgerwatch/diagnostics/cmd/ratelimit"
 )
 
 type LogListItem struct {
@@ -25,6 +31,8 @@ type LogList struct {
 	Error       string
 	SessionName string
 	List        []LogListItem
+	RateLimited bool
+	PrintedRate string
 }
 type LogPart struct {
 	Success bool
@@ -57,8 +65,14 @@ func ByteCount(b uint64) string {
 }
 
 // processLogList produces the list of available lots inside the div element (into the writer w), using log_list.html template and LogList object.
-func processLogList(w http.ResponseWriter, templ *template.Template, success bool, sessionName string, result string) {
+// limiter, if non-nil, is the session's configured transfer quota, surfaced in the
+// list so the operator can see why a download is throttled; pass nil for no limit.
+func processLogList(w http.ResponseWriter, templ *template.Template, success bool, sessionName string, result string, limiter *ratelimit.LinkLimiter) {
 	var ll = LogList{SessionName: sessionName}
+	if limiter != nil {
+		ll.RateLimited = true
+		ll.PrintedRate = ByteCount(uint64(limiter.Rate())) + "/s"
+	}
 	ll.processResponse(result, success)
 	if err := templ.ExecuteTemplate(w, "log_list.html", ll); err != nil {
 		fmt.Fprintf(w, "Failed executing log_list template: %v", err)
@@ -128,84 +142,224 @@ func (lp *LogPart) processResponse(result string, success bool) {
 	lp.Lines = lines
 }
 
-var logReadFirstLine = regexp.MustCompile("^SUCCESS: ([0-9]+)-([0-9]+)/([0-9]+)$")
+// logReadFirstLine matches the SUCCESS framing line, with an optional -GZ or -ZST
+// suffix indicating the chunk that follows is compressed with that coding.
+var logReadFirstLine = regexp.MustCompile("^SUCCESS(-GZ|-ZST)?: ([0-9]+)-([0-9]+)/([0-9]+)$")
 
-// parseLogPart parses the response from the erigon node, which contains a part of a log file.
-// It should start with a line of format: SUCCESS from_offset/to_offset/total_size,
-// followed by the actual log chunk.
-func parseLogPart(nodeRequest *NodeRequest, offset uint64) (bool, uint64, uint64, []byte, string) {
+// acceptEncoding is advertised on every /logs/read request so the node may stream
+// the chunk already compressed; parseLogPart decompresses it transparently.
+const acceptEncoding = "gzip,zstd"
+
+// parseLogPartHeader parses the SUCCESS[-GZ|-ZST]: from-to/total framing line off
+// nodeRequest's response and returns the coding (empty, "gzip" or "zstd") and the
+// still-encoded chunk payload, without decompressing it.
+func parseLogPartHeader(nodeRequest *NodeRequest, offset uint64) (clear bool, coding string, to uint64, total uint64, payload []byte, errStr string) {
 	nodeRequest.lock.Lock()
 	defer nodeRequest.lock.Unlock()
 	if !nodeRequest.served {
-		return false, 0, 0, nil, ""
+		return false, "", 0, 0, nil, ""
 	}
-	clear := nodeRequest.retries >= 16
+	clear = nodeRequest.retries >= 16
 	if nodeRequest.err != "" {
-		return clear, 0, 0, nil, nodeRequest.err
+		return clear, "", 0, 0, nil, nodeRequest.err
 	}
 	firstLineEnd := bytes.IndexByte(nodeRequest.response, '\n')
 	if firstLineEnd == -1 {
-		return clear, 0, 0, nil, "could not find first line in log part response"
+		return clear, "", 0, 0, nil, "could not find first line in log part response"
 	}
 	m := logReadFirstLine.FindSubmatch(nodeRequest.response[:firstLineEnd])
 	if m == nil {
-		return clear, 0, 0, nil, fmt.Sprintf("first line needs to have format SUCCESS: from-to/total, was [%sn", nodeRequest.response[:firstLineEnd])
+		return clear, "", 0, 0, nil, fmt.Sprintf("first line needs to have format SUCCESS[-GZ|-ZST]: from-to/total, was [%s]", nodeRequest.response[:firstLineEnd])
 	}
-	from, err := strconv.ParseUint(string(m[1]), 10, 64)
+	switch string(m[1]) {
+	case "-GZ":
+		coding = "gzip"
+	case "-ZST":
+		coding = "zstd"
+	}
+	from, err := strconv.ParseUint(string(m[2]), 10, 64)
 	if err != nil {
-		return clear, 0, 0, nil, fmt.Sprintf("parsing from: %v", err)
+		return clear, "", 0, 0, nil, fmt.Sprintf("parsing from: %v", err)
 	}
 	if from != offset {
-		return clear, 0, 0, nil, fmt.Sprintf("Unexpected from %d, wanted %d", from, offset)
+		return clear, "", 0, 0, nil, fmt.Sprintf("Unexpected from %d, wanted %d", from, offset)
+	}
+	to, err = strconv.ParseUint(string(m[3]), 10, 64)
+	if err != nil {
+		return clear, "", 0, 0, nil, fmt.Sprintf("parsing to: %v", err)
 	}
-	to, err := strconv.ParseUint(string(m[2]), 10, 64)
+	total, err = strconv.ParseUint(string(m[4]), 10, 64)
 	if err != nil {
-		return clear, 0, 0, nil, fmt.Sprintf("parsing to: %v", err)
+		return clear, "", 0, 0, nil, fmt.Sprintf("parsing total: %v", err)
+	}
+	return true, coding, to, total, nodeRequest.response[firstLineEnd+1:], ""
+}
+
+// decodePayload decompresses payload according to coding ("gzip", "zstd" or "").
+func decodePayload(coding string, payload []byte) ([]byte, error) {
+	switch coding {
+	case "gzip":
+		gz, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("opening gzip log part: %w", err)
+		}
+		defer gz.Close()
+		return io.ReadAll(gz)
+	case "zstd":
+		zr, err := zstd.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("opening zstd log part: %w", err)
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	default:
+		return payload, nil
 	}
-	total, err := strconv.ParseUint(string(m[3]), 10, 64)
+}
+
+// parseLogPart parses the response from the erigon node, which contains a part of a log file.
+// It should start with a line of format: SUCCESS[-GZ|-ZST]: from_offset-to_offset/total_size,
+// followed by the actual (possibly compressed) log chunk, which is decompressed before return.
+func parseLogPart(nodeRequest *NodeRequest, offset uint64) (bool, uint64, uint64, []byte, string) {
+	clear, coding, to, total, payload, errStr := parseLogPartHeader(nodeRequest, offset)
+	if !clear || errStr != "" {
+		return clear, to, total, nil, errStr
+	}
+	decoded, err := decodePayload(coding, payload)
 	if err != nil {
-		return clear, 0, 0, nil, fmt.Sprintf("parsing total: %v", err)
+		return true, 0, 0, nil, err.Error()
 	}
-	return true, to, total, nodeRequest.response[firstLineEnd+1:], ""
+	return true, to, total, decoded, ""
 }
 
+const (
+	defaultChunkSize         = 4 * 1024 * 1024 // 4MB windows per ranged request
+	defaultMaxParallelChunks = 4
+)
+
 // LogReader implements io.ReaderSeeker to be used as parameter to http.ServeContent.
+//
+// Rather than fetching the file sequentially one round-trip at a time, Read splits
+// it into ChunkSize windows and keeps up to MaxParallelChunks of them in flight on
+// requestChannel at once, reassembling them in offset order as they complete. This
+// lets http.ServeContent's Range support (driven by Seek) skip straight to the
+// window it needs instead of paying for every preceding round-trip.
 type LogReader struct {
 	filename       string // Name of the log files to download
 	requestChannel chan *NodeRequest
 	total          uint64 // Size of the log file to be downloaded. Needs to be known before download
 	offset         uint64 // Current offset set either by the Seek() or Read() functions
 	ctx            context.Context
+
+	ChunkSize         uint64 // size of each ranged chunk request
+	MaxParallelChunks int    // chunk requests kept in flight at once
+	Limiter           *ratelimit.LinkLimiter // throttles bytes returned by Read, nil for no limit
+
+	mu       sync.Mutex
+	fetched  map[uint64][]byte     // chunk start offset -> bytes, once retrieved
+	inFlight map[uint64]*NodeRequest
 }
 
-// Read is part of the io.Reader interface - emulates reading from the remote logs as if it was from the web server itself.
-func (lr *LogReader) Read(p []byte) (n int, err error) {
-	nodeRequest := &NodeRequest{url: fmt.Sprintf("/logs/read?file=%s&offset=%d\n", url.QueryEscape(lr.filename), lr.offset)}
-	lr.requestChannel <- nodeRequest
-	var total uint64
-	var clear bool
-	var part []byte
-	var errStr string
-	for nodeRequest != nil {
-		select {
-		case <-lr.ctx.Done():
-			return 0, fmt.Errorf("interrupted")
-		default:
+// chunkStart rounds offset down to the start of the chunk window it falls in.
+func (lr *LogReader) chunkStart(offset uint64) uint64 {
+	return (offset / lr.ChunkSize) * lr.ChunkSize
+}
+
+// dispatchLocked issues NodeRequests for the chunk window starting at start and
+// for up to MaxParallelChunks-1 windows ahead of it, skipping windows that are
+// already fetched or already in flight. Callers must hold lr.mu.
+func (lr *LogReader) dispatchLocked(start uint64) {
+	for i := 0; i < lr.MaxParallelChunks; i++ {
+		chunkOffset := start + uint64(i)*lr.ChunkSize
+		if lr.total > 0 && chunkOffset >= lr.total {
+			break
 		}
-		clear, _, total, part, errStr = parseLogPart(nodeRequest, lr.offset)
-		if clear {
-			nodeRequest = nil
-		} else {
-			time.Sleep(100 * time.Millisecond)
+		if _, ok := lr.fetched[chunkOffset]; ok {
+			continue
 		}
+		if _, ok := lr.inFlight[chunkOffset]; ok {
+			continue
+		}
+		nodeRequest := newNodeRequest(fmt.Sprintf("/logs/read?file=%s&offset=%d&length=%d&accept-encoding=%s\n", url.QueryEscape(lr.filename), chunkOffset, lr.ChunkSize, url.QueryEscape(acceptEncoding)))
+		lr.inFlight[chunkOffset] = nodeRequest
+		lr.requestChannel <- nodeRequest
+		go watchNodeRequest(lr.ctx, nodeRequest)
+	}
+}
+
+// chunk returns the bytes for the chunk window starting at start, dispatching it
+// (and prefetching the windows ahead of it) if it hasn't been fetched yet. It
+// blocks on the request's done channel rather than polling, and evicts windows
+// the reader has already moved past so lr.fetched stays bounded to roughly
+// MaxParallelChunks windows regardless of file size.
+func (lr *LogReader) chunk(start uint64) ([]byte, error) {
+	lr.mu.Lock()
+	if data, ok := lr.fetched[start]; ok {
+		lr.mu.Unlock()
+		return data, nil
+	}
+	lr.dispatchLocked(start)
+	nodeRequest := lr.inFlight[start]
+	lr.mu.Unlock()
+
+	select {
+	case <-lr.ctx.Done():
+		return nil, fmt.Errorf("interrupted")
+	case <-nodeRequest.done:
 	}
+
+	_, _, total, part, errStr := parseLogPart(nodeRequest, start)
 	if errStr != "" {
-		return 0, fmt.Errorf(errStr)
+		return nil, fmt.Errorf(errStr)
 	}
+
+	lr.mu.Lock()
 	lr.total = total
-	copied := copy(p, part)
+	lr.fetched[start] = part
+	delete(lr.inFlight, start)
+	lr.evictLocked()
+	lr.mu.Unlock()
+	return part, nil
+}
+
+// evictLocked drops fetched windows that lr.offset has moved past, since Read
+// only ever looks them up by lr.chunkStart(lr.offset). Callers must hold lr.mu.
+func (lr *LogReader) evictLocked() {
+	boundary := lr.chunkStart(lr.offset)
+	for start := range lr.fetched {
+		if start < boundary {
+			delete(lr.fetched, start)
+		}
+	}
+}
+
+// Read is part of the io.Reader interface - emulates reading from the remote logs as if it was from the web server itself.
+func (lr *LogReader) Read(p []byte) (n int, err error) {
+	start := lr.chunkStart(lr.offset)
+	part, err := lr.chunk(start)
+	if err != nil {
+		return 0, err
+	}
+	within := lr.offset - start
+	if within >= uint64(len(part)) {
+		if lr.total > 0 && lr.offset >= lr.total {
+			return 0, io.EOF
+		}
+		return 0, fmt.Errorf("empty chunk at offset %d", lr.offset)
+	}
+	copied := copy(p, part[within:])
+	if lr.Limiter != nil {
+		if err := lr.Limiter.WaitN(lr.ctx, copied); err != nil {
+			return 0, err
+		}
+	}
 	lr.offset += uint64(copied)
-	if lr.offset == total {
+
+	lr.mu.Lock()
+	lr.evictLocked()
+	lr.mu.Unlock()
+
+	if lr.total > 0 && lr.offset >= lr.total {
 		return copied, io.EOF
 	}
 	return copied, nil
@@ -229,8 +383,9 @@ func (lr *LogReader) Seek(offset int64, whence int) (int64, error) {
 }
 
 // Handles the use case when operator clicks on the link with the log file name, and this initiates the download of this file
-// to the operator's computer (via browser). See LogReader above which is used in http.ServeContent
-func transmitLogFile(ctx context.Context, r *http.Request, w http.ResponseWriter, sessionName string, filename string, size uint64, requestChannel chan *NodeRequest) {
+// to the operator's computer (via browser). See LogReader above which is used in http.ServeContent. limiter throttles the
+// transfer to the session's configured bytes/sec quota; pass nil for no limit.
+func transmitLogFile(ctx context.Context, r *http.Request, w http.ResponseWriter, sessionName string, filename string, size uint64, requestChannel chan *NodeRequest, limiter *ratelimit.LinkLimiter) {
 	if requestChannel == nil {
 		fmt.Fprintf(w, "ERROR: Node is not allocated\n")
 		return
@@ -238,6 +393,120 @@ func transmitLogFile(ctx context.Context, r *http.Request, w http.ResponseWriter
 	cd := mime.FormatMediaType("attachment", map[string]string{"filename": sessionName + "_" + filename})
 	w.Header().Set("Content-Disposition", cd)
 	w.Header().Set("Content-Type", "application/octet-stream")
-	logReader := &LogReader{filename: filename, requestChannel: requestChannel, offset: 0, total: size, ctx: ctx}
+
+	// A whole-file download with no Range header doesn't need the ranged/parallel
+	// LogReader machinery at all: ask the node for the file pre-gzipped and pass
+	// the compressed bytes straight through, so nothing is decompressed and then
+	// recompressed in between.
+	if r.Header.Get("Range") == "" && acceptsGzip(r.Header.Get("Accept-Encoding")) {
+		if transmitGzippedLogFile(ctx, w, filename, size, requestChannel, limiter) {
+			return
+		}
+	}
+
+	logReader := &LogReader{
+		filename:          filename,
+		requestChannel:    requestChannel,
+		offset:            0,
+		total:             size,
+		ctx:               ctx,
+		ChunkSize:         defaultChunkSize,
+		MaxParallelChunks: defaultMaxParallelChunks,
+		Limiter:           limiter,
+		fetched:           make(map[uint64][]byte),
+		inFlight:          make(map[uint64]*NodeRequest),
+	}
 	http.ServeContent(w, r, filename, time.Now(), logReader)
 }
+
+// acceptsGzip reports whether an Accept-Encoding header value allows gzip.
+func acceptsGzip(header string) bool {
+	for _, enc := range strings.Split(header, ",") {
+		if strings.TrimSpace(strings.SplitN(enc, ";", 2)[0]) == "gzip" {
+			return true
+		}
+	}
+	return false
+}
+
+// transmitGzippedLogFile requests filename from the node in the same
+// defaultChunkSize windows as LogReader, each asked to be gzip-compressed
+// independently, and streams the still-compressed windows to w in order as
+// they arrive. It never holds more than defaultMaxParallelChunks windows in
+// flight, so - unlike fetching the whole file in one round-trip - memory use
+// stays bounded regardless of file size. Concatenated gzip members decode
+// identically to one big member (RFC 1952), so the windows can be written out
+// back to back with no reframing. Returns false without having written
+// anything if the node doesn't honor gzip for this file, so the caller can
+// fall back to the regular ranged LogReader path. Once the header (and the
+// first byte) has been written, falling back would mean sending a second,
+// conflicting response, so a failure at that point instead aborts the
+// connection (panic(http.ErrAbortHandler)) rather than returning normally -
+// with no Content-Length set, a plain return would let net/http finish the
+// chunked response normally and hand the client a clean 200 with a silently
+// truncated gzip body.
+func transmitGzippedLogFile(ctx context.Context, w http.ResponseWriter, filename string, size uint64, requestChannel chan *NodeRequest, limiter *ratelimit.LinkLimiter) bool {
+	if size == 0 {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.WriteHeader(http.StatusOK)
+		return true
+	}
+
+	var inFlight []*NodeRequest
+	nextOffset := uint64(0)
+	dispatch := func() {
+		for len(inFlight) < defaultMaxParallelChunks && nextOffset < size {
+			nodeRequest := newNodeRequest(fmt.Sprintf("/logs/read?file=%s&offset=%d&length=%d&accept-encoding=gzip\n", url.QueryEscape(filename), nextOffset, defaultChunkSize))
+			requestChannel <- nodeRequest
+			go watchNodeRequest(ctx, nodeRequest)
+			inFlight = append(inFlight, nodeRequest)
+			nextOffset += defaultChunkSize
+		}
+	}
+	dispatch()
+
+	headerWritten := false
+	// fail reports a chunk failure. Before the header is committed, it's safe
+	// to report this to the caller so it can fall back to the ranged
+	// LogReader path; once the header is already on the wire, that fallback
+	// would conflict with the response already in flight, so it aborts the
+	// connection outright instead.
+	fail := func() bool {
+		if headerWritten {
+			panic(http.ErrAbortHandler)
+		}
+		return false
+	}
+
+	offset := uint64(0)
+	for len(inFlight) > 0 {
+		nodeRequest := inFlight[0]
+		inFlight = inFlight[1:]
+
+		select {
+		case <-ctx.Done():
+			return fail()
+		case <-nodeRequest.done:
+		}
+		clear, coding, _, _, payload, errStr := parseLogPartHeader(nodeRequest, offset)
+		if !clear || errStr != "" || coding != "gzip" {
+			return fail()
+		}
+		if !headerWritten {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.WriteHeader(http.StatusOK)
+			headerWritten = true
+		}
+		if limiter != nil {
+			if err := limiter.WaitN(ctx, len(payload)); err != nil {
+				panic(http.ErrAbortHandler)
+			}
+		}
+		if _, err := w.Write(payload); err != nil {
+			return true
+		}
+		offset += defaultChunkSize
+		dispatch()
+	}
+	return true
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// startFakeNode starts a goroutine that serves NodeRequests sent on
+// requestChannel by slicing data according to the offset/length query
+// parameters on each request's URL, mimicking the node's /logs/read handler
+// closely enough to exercise LogReader end to end.
+func startFakeNode(t *testing.T, requestChannel chan *NodeRequest, data []byte) {
+	t.Helper()
+	go func() {
+		for nodeRequest := range requestChannel {
+			u, err := url.Parse(strings.TrimSuffix(nodeRequest.url, "\n"))
+			if err != nil {
+				t.Errorf("parsing request url %q: %v", nodeRequest.url, err)
+				continue
+			}
+			q := u.Query()
+			offset, _ := strconv.ParseUint(q.Get("offset"), 10, 64)
+			length, _ := strconv.ParseUint(q.Get("length"), 10, 64)
+			if length == 0 || offset+length > uint64(len(data)) {
+				length = uint64(len(data)) - offset
+			}
+			to := offset + length
+			response := fmt.Sprintf("SUCCESS: %d-%d/%d\n", offset, to, len(data))
+
+			nodeRequest.lock.Lock()
+			nodeRequest.response = append([]byte(response), data[offset:to]...)
+			nodeRequest.served = true
+			nodeRequest.lock.Unlock()
+			nodeRequest.signalIfDone()
+		}
+	}()
+}
+
+func newTestLogReader(requestChannel chan *NodeRequest, total uint64, chunkSize uint64, maxParallel int) *LogReader {
+	return &LogReader{
+		filename:          "test.log",
+		requestChannel:    requestChannel,
+		total:             total,
+		ctx:               context.Background(),
+		ChunkSize:         chunkSize,
+		MaxParallelChunks: maxParallel,
+		fetched:           make(map[uint64][]byte),
+		inFlight:          make(map[uint64]*NodeRequest),
+	}
+}
+
+func TestLogReaderChunkStart(t *testing.T) {
+	lr := &LogReader{ChunkSize: 10}
+	cases := map[uint64]uint64{0: 0, 5: 0, 9: 0, 10: 10, 15: 10, 20: 20}
+	for offset, want := range cases {
+		if got := lr.chunkStart(offset); got != want {
+			t.Errorf("chunkStart(%d) = %d, want %d", offset, got, want)
+		}
+	}
+}
+
+func TestLogReaderDispatchLockedPrefetchesAhead(t *testing.T) {
+	requestChannel := make(chan *NodeRequest, 10)
+	defer close(requestChannel)
+	lr := newTestLogReader(requestChannel, 25, 10, 3)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lr.ctx = ctx
+
+	lr.mu.Lock()
+	lr.dispatchLocked(0)
+	lr.mu.Unlock()
+
+	if len(lr.inFlight) != 3 {
+		t.Fatalf("expected 3 in-flight chunk requests, got %d", len(lr.inFlight))
+	}
+	for _, start := range []uint64{0, 10, 20} {
+		if _, ok := lr.inFlight[start]; !ok {
+			t.Errorf("expected chunk window %d to be dispatched", start)
+		}
+	}
+}
+
+func TestLogReaderDispatchLockedStopsAtEOF(t *testing.T) {
+	requestChannel := make(chan *NodeRequest, 10)
+	defer close(requestChannel)
+	lr := newTestLogReader(requestChannel, 15, 10, 3)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lr.ctx = ctx
+
+	lr.mu.Lock()
+	lr.dispatchLocked(10)
+	lr.mu.Unlock()
+
+	if len(lr.inFlight) != 1 {
+		t.Fatalf("expected only the final window (10) to be dispatched, got %d windows", len(lr.inFlight))
+	}
+	if _, ok := lr.inFlight[10]; !ok {
+		t.Fatalf("expected window 10 to be dispatched")
+	}
+}
+
+func TestLogReaderReadReassemblesInOrder(t *testing.T) {
+	data := make([]byte, 37)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	requestChannel := make(chan *NodeRequest, 16)
+	startFakeNode(t, requestChannel, data)
+	defer close(requestChannel)
+
+	lr := newTestLogReader(requestChannel, uint64(len(data)), 8, 3)
+
+	got, err := io.ReadAll(lr)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if string(got) != string(data) {
+		t.Fatalf("got %v, want %v", got, data)
+	}
+}
+
+func TestLogReaderEvictsOldChunks(t *testing.T) {
+	data := make([]byte, 40)
+	requestChannel := make(chan *NodeRequest, 16)
+	startFakeNode(t, requestChannel, data)
+	defer close(requestChannel)
+
+	lr := newTestLogReader(requestChannel, uint64(len(data)), 4, 2)
+
+	buf := make([]byte, 1)
+	for lr.offset < uint64(len(data)) {
+		_, err := lr.Read(buf)
+		if err != nil && err != io.EOF {
+			t.Fatalf("Read: %v", err)
+		}
+
+		lr.mu.Lock()
+		resident := len(lr.fetched)
+		lr.mu.Unlock()
+		if resident > lr.MaxParallelChunks+1 {
+			t.Fatalf("fetched holds %d windows resident after offset %d, want at most %d", resident, lr.offset, lr.MaxParallelChunks+1)
+		}
+	}
+}
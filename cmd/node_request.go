@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"context"
+	"sync"
+)
+
+// NodeRequest is a single request dispatched to the connected node over a
+// session's requestChannel. Whatever drains that channel fills in
+// served/response/err (or bumps retries) as the round-trip completes, and
+// must call signalIfDone right afterwards so done is closed exactly once the
+// request reaches a terminal state (served, or retries exhausted). Callers
+// wait on nodeRequest.done instead of polling those fields directly.
+type NodeRequest struct {
+	url string
+
+	lock     sync.Mutex
+	served   bool
+	retries  int
+	err      string
+	response []byte
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newNodeRequest builds a NodeRequest ready to be sent on a requestChannel.
+func newNodeRequest(url string) *NodeRequest {
+	return &NodeRequest{url: url, done: make(chan struct{})}
+}
+
+// signalIfDone closes nodeRequest.done, exactly once, if it has reached a
+// terminal state (served, or retries exhausted).
+func (nodeRequest *NodeRequest) signalIfDone() {
+	nodeRequest.lock.Lock()
+	done := nodeRequest.served || nodeRequest.retries >= 16
+	nodeRequest.lock.Unlock()
+	if done {
+		nodeRequest.closeOnce.Do(func() { close(nodeRequest.done) })
+	}
+}
+
+// watchNodeRequest closes nodeRequest.done once ctx is done, in case the
+// request never reaches a terminal state (and so never calls signalIfDone) on
+// its own.
+func watchNodeRequest(ctx context.Context, nodeRequest *NodeRequest) {
+	select {
+	case <-ctx.Done():
+		nodeRequest.closeOnce.Do(func() { close(nodeRequest.done) })
+	case <-nodeRequest.done:
+	}
+}
@@ -0,0 +1,82 @@
+// Package ratelimit provides token-bucket throughput limiting for large-payload
+// transfers between the diagnostics server and a node, such as log downloads and
+// (eventually) DB snapshot reads, so a single operator session can't saturate a
+// live node's uplink.
+package ratelimit
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// LinkLimiter throttles one session's transfers to a configurable bytes/sec
+// rate, additionally capped by an optional limiter shared across all sessions.
+type LinkLimiter struct {
+	mu      sync.RWMutex
+	session *rate.Limiter
+	global  *rate.Limiter
+}
+
+// NewGlobalLimiter builds a limiter meant to be shared by every LinkLimiter, so
+// the combined throughput of all sessions stays under a single operator-wide cap.
+func NewGlobalLimiter(bytesPerSec, burst int) *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(bytesPerSec), burst)
+}
+
+// NewLinkLimiter creates a per-session limiter allowing bytesPerSec sustained
+// throughput with the given burst. global may be nil if no cross-session cap
+// applies.
+func NewLinkLimiter(bytesPerSec, burst int, global *rate.Limiter) *LinkLimiter {
+	return &LinkLimiter{session: rate.NewLimiter(rate.Limit(bytesPerSec), burst), global: global}
+}
+
+// WaitN blocks until n bytes are allowed to be transferred under both the
+// per-session and (if configured) the global limit, or until ctx is done.
+func (l *LinkLimiter) WaitN(ctx context.Context, n int) error {
+	l.mu.RLock()
+	session, global := l.session, l.global
+	l.mu.RUnlock()
+
+	// rate.Limiter.WaitN rejects n larger than the burst, so split oversized
+	// reads (e.g. a whole pre-gzipped log file) into burst-sized waits.
+	for n > 0 {
+		step := n
+		if b := session.Burst(); step > b {
+			step = b
+		}
+		if global != nil {
+			if gb := global.Burst(); step > gb {
+				step = gb
+			}
+		}
+		if global != nil {
+			if err := global.WaitN(ctx, step); err != nil {
+				return err
+			}
+		}
+		if err := session.WaitN(ctx, step); err != nil {
+			return err
+		}
+		n -= step
+	}
+	return nil
+}
+
+// SetLimit updates the per-session bytes/sec rate and burst, e.g. in response to
+// an operator changing it in the session UI.
+func (l *LinkLimiter) SetLimit(bytesPerSec, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.session.SetLimit(rate.Limit(bytesPerSec))
+	l.session.SetBurst(burst)
+}
+
+// Rate returns the currently configured bytes/sec limit, for display in the
+// session UI.
+func (l *LinkLimiter) Rate() float64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return float64(l.session.Limit())
+}
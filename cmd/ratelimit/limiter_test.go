@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestLinkLimiterWaitNSplitsOversizedReads(t *testing.T) {
+	l := NewLinkLimiter(1<<30, 10, nil)
+	start := time.Now()
+	if err := l.WaitN(context.Background(), 35); err != nil {
+		t.Fatalf("WaitN: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("WaitN took %v, expected it to drain quickly given a large bytesPerSec budget", elapsed)
+	}
+}
+
+func TestLinkLimiterWaitNRespectsGlobalCap(t *testing.T) {
+	global := NewGlobalLimiter(1, 1)
+	l := NewLinkLimiter(1<<30, 1<<30, global)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	// The session limiter alone would allow this instantly; the shared global
+	// limiter (1 byte/sec, burst 1) should be the one that makes a second
+	// byte wait long enough for the context to expire first.
+	if err := l.WaitN(ctx, 1); err != nil {
+		t.Fatalf("first WaitN: %v", err)
+	}
+	if err := l.WaitN(ctx, 1); err == nil {
+		t.Fatalf("expected second WaitN to block on the global limiter until ctx expired")
+	}
+}
+
+func TestLinkLimiterWaitNCancelled(t *testing.T) {
+	l := NewLinkLimiter(1, 1, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.WaitN(ctx, 1); err == nil {
+		t.Fatalf("expected WaitN to return an error for an already-cancelled context")
+	}
+}
+
+func TestLinkLimiterSetLimitAndRate(t *testing.T) {
+	l := NewLinkLimiter(100, 100, nil)
+	if got := l.Rate(); got != 100 {
+		t.Fatalf("Rate() = %v, want 100", got)
+	}
+	l.SetLimit(500, 500)
+	if got := l.Rate(); got != 500 {
+		t.Fatalf("Rate() after SetLimit = %v, want 500", got)
+	}
+}
+
+func TestNewGlobalLimiterUsesGivenRateAndBurst(t *testing.T) {
+	g := NewGlobalLimiter(42, 7)
+	if got := g.Limit(); got != rate.Limit(42) {
+		t.Fatalf("Limit() = %v, want 42", got)
+	}
+	if got := g.Burst(); got != 7 {
+		t.Fatalf("Burst() = %v, want 7", got)
+	}
+}
@@ -0,0 +1,300 @@
+package cmd
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// StructuredLogLine is one parsed Erigon log line, whether it arrived as a JSON
+// object or as log15-style "LVL[ts] message key=value ..." text.
+type StructuredLogLine struct {
+	Timestamp time.Time
+	Level     string
+	Module    string
+	Message   string
+	Fields    map[string]string
+}
+
+// StructuredLogPart is the structured counterpart of LogPart, rendered by
+// log_read_structured.html, which colorizes by level and lets the operator
+// toggle field columns.
+type StructuredLogPart struct {
+	Success bool
+	Error   string
+	Lines   []StructuredLogLine
+}
+
+// processResponse decodes payload (already stripped of the SUCCESS[-GZ|-ZST]
+// framing line) into structured lines, or records errStr/!success as an error.
+func (slp *StructuredLogPart) processResponse(payload []byte, success bool, errStr string) {
+	if !success {
+		slp.Error = errStr
+		return
+	}
+	frames, err := splitLengthPrefixedFrames(payload)
+	if err != nil {
+		slp.Error = err.Error()
+		return
+	}
+	slp.Success = true
+	for _, f := range frames {
+		slp.Lines = append(slp.Lines, parseStructuredLine(string(f)))
+	}
+}
+
+// Produces (into writer w) a structured log part inside the div HTML element,
+// using log_read_structured.html and StructuredLogPart.
+func processStructuredLogPart(w http.ResponseWriter, templ *template.Template, success bool, payload []byte, errStr string) {
+	var slp StructuredLogPart
+	slp.processResponse(payload, success, errStr)
+	if err := templ.ExecuteTemplate(w, "log_read_structured.html", slp); err != nil {
+		fmt.Fprintf(w, "Failed executing log_read_structured template: %v", err)
+		return
+	}
+}
+
+// splitLengthPrefixedFrames splits payload into length-prefixed frames - a
+// 4-byte big-endian length followed by that many bytes, repeated until payload
+// is consumed. Unlike \n-splitting, this survives a message containing
+// embedded newlines.
+func splitLengthPrefixedFrames(payload []byte) ([][]byte, error) {
+	var frames [][]byte
+	for len(payload) > 0 {
+		if len(payload) < 4 {
+			return nil, fmt.Errorf("truncated frame length")
+		}
+		n := binary.BigEndian.Uint32(payload[:4])
+		payload = payload[4:]
+		if uint64(len(payload)) < uint64(n) {
+			return nil, fmt.Errorf("truncated frame body")
+		}
+		frames = append(frames, payload[:n])
+		payload = payload[n:]
+	}
+	return frames, nil
+}
+
+// kvPairRe matches key=value and key="quoted value" tokens in a log15-style line.
+var kvPairRe = regexp.MustCompile(`(\w+)=("(?:[^"\\]|\\.)*"|\S+)`)
+
+// log15TimestampLayout is the layout log15 uses for its bracketed inline
+// timestamp (e.g. "01-02|03:04:05.678"). It carries no year, so
+// splitLevelTimestamp fills in the current one.
+const log15TimestampLayout = "01-02|15:04:05.000"
+
+// splitLevelTimestamp splits a log15 level token such as
+// "WARN[01-02|03:04:05.678]" into the bare level and its parsed timestamp. It
+// returns token unchanged and a zero time if token doesn't carry a bracketed
+// timestamp or that timestamp fails to parse.
+func splitLevelTimestamp(token string) (string, time.Time) {
+	open := strings.IndexByte(token, '[')
+	if open == -1 || !strings.HasSuffix(token, "]") {
+		return token, time.Time{}
+	}
+	t, err := time.Parse(log15TimestampLayout, token[open+1:len(token)-1])
+	if err != nil {
+		return token, time.Time{}
+	}
+	now := time.Now()
+	return token[:open], time.Date(now.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// parseStructuredLine parses one raw log line, either a JSON object or a
+// log15-style "LVL[ts] message key=value ..." line, into a StructuredLogLine.
+func parseStructuredLine(raw string) StructuredLogLine {
+	line := StructuredLogLine{Fields: map[string]string{}}
+	if strings.HasPrefix(strings.TrimSpace(raw), "{") {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(raw), &obj); err == nil {
+			for k, v := range obj {
+				var s string
+				if err := json.Unmarshal(v, &s); err != nil {
+					s = string(v)
+				}
+				switch strings.ToLower(k) {
+				case "ts", "time", "timestamp":
+					if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+						line.Timestamp = t
+					}
+				case "lvl", "level":
+					line.Level = s
+				case "module", "component", "pkg":
+					line.Module = s
+				case "msg", "message":
+					line.Message = s
+				default:
+					line.Fields[k] = s
+				}
+			}
+			return line
+		}
+	}
+
+	matches := kvPairRe.FindAllStringSubmatchIndex(raw, -1)
+	prefixEnd := len(raw)
+	if len(matches) > 0 {
+		prefixEnd = matches[0][0]
+	}
+	prefix := strings.TrimSpace(raw[:prefixEnd])
+	if sp := strings.IndexByte(prefix, ' '); sp >= 0 {
+		line.Level, line.Timestamp = splitLevelTimestamp(prefix[:sp])
+		line.Message = strings.TrimSpace(prefix[sp+1:])
+	} else {
+		line.Message = prefix
+	}
+	for _, m := range matches {
+		key := raw[m[2]:m[3]]
+		val := strings.Trim(raw[m[4]:m[5]], `"`)
+		if strings.ToLower(key) == "module" || strings.ToLower(key) == "component" {
+			line.Module = val
+			continue
+		}
+		line.Fields[key] = val
+	}
+	return line
+}
+
+// logLevelOrder ranks log levels from least to most severe, for MinLevel comparisons.
+var logLevelOrder = map[string]int{"trace": 0, "debug": 1, "info": 2, "warn": 3, "error": 4, "crit": 5}
+
+// LogFilter is a filter pushed down to the node for /logs/read so that lines
+// which don't match never cross the wire.
+type LogFilter struct {
+	MinLevel  string         // e.g. "warn": this level or more severe
+	Module    string         // exact module/component match
+	MsgRegexp *regexp.Regexp // message must match
+	From, To  time.Time      // optional timestamp range; zero value is unbounded
+}
+
+// ParseLogFilter parses a ";"-separated filter query such as
+// "level>=warn;module=txpool;msg~=timeout" into a LogFilter. An empty query
+// returns a nil filter, matching everything.
+func ParseLogFilter(query string) (*LogFilter, error) {
+	if query == "" {
+		return nil, nil
+	}
+	f := &LogFilter{}
+	for _, term := range strings.Split(query, ";") {
+		switch {
+		case strings.HasPrefix(term, "level>="):
+			f.MinLevel = strings.ToLower(strings.TrimPrefix(term, "level>="))
+			if _, ok := logLevelOrder[f.MinLevel]; !ok {
+				return nil, fmt.Errorf("unknown level %q", f.MinLevel)
+			}
+		case strings.HasPrefix(term, "module="):
+			f.Module = strings.TrimPrefix(term, "module=")
+		case strings.HasPrefix(term, "msg~="):
+			re, err := regexp.Compile(strings.TrimPrefix(term, "msg~="))
+			if err != nil {
+				return nil, fmt.Errorf("invalid msg regexp: %w", err)
+			}
+			f.MsgRegexp = re
+		case strings.HasPrefix(term, "from="):
+			t, err := time.Parse(time.RFC3339, strings.TrimPrefix(term, "from="))
+			if err != nil {
+				return nil, fmt.Errorf("invalid from: %w", err)
+			}
+			f.From = t
+		case strings.HasPrefix(term, "to="):
+			t, err := time.Parse(time.RFC3339, strings.TrimPrefix(term, "to="))
+			if err != nil {
+				return nil, fmt.Errorf("invalid to: %w", err)
+			}
+			f.To = t
+		default:
+			return nil, fmt.Errorf("unrecognized filter term %q", term)
+		}
+	}
+	return f, nil
+}
+
+// Matches reports whether line satisfies every clause of the filter. A nil
+// filter matches everything.
+func (f *LogFilter) Matches(line StructuredLogLine) bool {
+	if f == nil {
+		return true
+	}
+	if f.MinLevel != "" && logLevelOrder[strings.ToLower(line.Level)] < logLevelOrder[f.MinLevel] {
+		return false
+	}
+	if f.Module != "" && line.Module != f.Module {
+		return false
+	}
+	if f.MsgRegexp != nil && !f.MsgRegexp.MatchString(line.Message) {
+		return false
+	}
+	if !f.From.IsZero() && line.Timestamp.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && line.Timestamp.After(f.To) {
+		return false
+	}
+	return true
+}
+
+// String reassembles the filter into the &filter= query value sent to the node.
+// A nil filter reassembles to the empty string.
+func (f *LogFilter) String() string {
+	if f == nil {
+		return ""
+	}
+	var terms []string
+	if f.MinLevel != "" {
+		terms = append(terms, "level>="+f.MinLevel)
+	}
+	if f.Module != "" {
+		terms = append(terms, "module="+f.Module)
+	}
+	if f.MsgRegexp != nil {
+		terms = append(terms, "msg~="+f.MsgRegexp.String())
+	}
+	if !f.From.IsZero() {
+		terms = append(terms, "from="+f.From.Format(time.RFC3339))
+	}
+	if !f.To.IsZero() {
+		terms = append(terms, "to="+f.To.Format(time.RFC3339))
+	}
+	return strings.Join(terms, ";")
+}
+
+// fetchStructuredLogPart issues a single structured /logs/read request for
+// filename at offset, with filter pushed down to the node so unmatched lines
+// never cross the wire, and renders the result with log_read_structured.html.
+func fetchStructuredLogPart(ctx context.Context, requestChannel chan *NodeRequest, templ *template.Template, w http.ResponseWriter, filename string, offset uint64, filter *LogFilter) {
+	u := fmt.Sprintf("/logs/read?file=%s&offset=%d&structured=1&accept-encoding=%s", url.QueryEscape(filename), offset, url.QueryEscape(acceptEncoding))
+	if terms := filter.String(); terms != "" {
+		u += "&filter=" + url.QueryEscape(terms)
+	}
+	nodeRequest := newNodeRequest(u + "\n")
+	requestChannel <- nodeRequest
+	go watchNodeRequest(ctx, nodeRequest)
+
+	select {
+	case <-ctx.Done():
+		processStructuredLogPart(w, templ, false, nil, "interrupted")
+		return
+	case <-nodeRequest.done:
+	}
+
+	clear, coding, _, _, payload, errStr := parseLogPartHeader(nodeRequest, offset)
+	if !clear {
+		processStructuredLogPart(w, templ, false, nil, "node did not respond")
+		return
+	}
+	if errStr == "" {
+		var err error
+		payload, err = decodePayload(coding, payload)
+		if err != nil {
+			errStr = err.Error()
+		}
+	}
+	processStructuredLogPart(w, templ, errStr == "", payload, errStr)
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestParseLogFilterEmpty(t *testing.T) {
+	f, err := ParseLogFilter("")
+	if err != nil {
+		t.Fatalf("ParseLogFilter: %v", err)
+	}
+	if f != nil {
+		t.Fatalf("expected nil filter for an empty query, got %+v", f)
+	}
+}
+
+func TestParseLogFilterAllTerms(t *testing.T) {
+	f, err := ParseLogFilter("level>=warn;module=txpool;msg~=time.*out;from=2026-01-01T00:00:00Z;to=2026-01-02T00:00:00Z")
+	if err != nil {
+		t.Fatalf("ParseLogFilter: %v", err)
+	}
+	if f.MinLevel != "warn" {
+		t.Errorf("MinLevel = %q, want warn", f.MinLevel)
+	}
+	if f.Module != "txpool" {
+		t.Errorf("Module = %q, want txpool", f.Module)
+	}
+	if f.MsgRegexp == nil || !f.MsgRegexp.MatchString("timed out") {
+		t.Errorf("MsgRegexp did not match expected message")
+	}
+	if f.From.IsZero() || f.To.IsZero() {
+		t.Errorf("From/To not parsed: %+v", f)
+	}
+}
+
+func TestParseLogFilterErrors(t *testing.T) {
+	cases := []string{
+		"level>=noisy",
+		"from=not-a-time",
+		"to=not-a-time",
+		"msg~=(unclosed",
+		"bogus=term",
+	}
+	for _, query := range cases {
+		if _, err := ParseLogFilter(query); err == nil {
+			t.Errorf("ParseLogFilter(%q): expected error, got nil", query)
+		}
+	}
+}
+
+func TestLogFilterMatches(t *testing.T) {
+	f := &LogFilter{MinLevel: "warn", Module: "txpool"}
+	below := StructuredLogLine{Level: "info", Module: "txpool"}
+	if f.Matches(below) {
+		t.Errorf("expected info to fail a warn-or-above filter")
+	}
+	wrongModule := StructuredLogLine{Level: "error", Module: "rpc"}
+	if f.Matches(wrongModule) {
+		t.Errorf("expected rpc module to fail a txpool-only filter")
+	}
+	ok := StructuredLogLine{Level: "crit", Module: "txpool"}
+	if !f.Matches(ok) {
+		t.Errorf("expected crit/txpool to satisfy the filter")
+	}
+	var nilFilter *LogFilter
+	if !nilFilter.Matches(ok) {
+		t.Errorf("a nil filter should match everything")
+	}
+}
+
+func TestLogFilterStringRoundTrips(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := &LogFilter{MinLevel: "warn", Module: "txpool", From: from}
+	terms := f.String()
+	parsed, err := ParseLogFilter(terms)
+	if err != nil {
+		t.Fatalf("ParseLogFilter(%q): %v", terms, err)
+	}
+	if parsed.MinLevel != f.MinLevel || parsed.Module != f.Module || !parsed.From.Equal(f.From) {
+		t.Errorf("round trip mismatch: got %+v, want %+v", parsed, f)
+	}
+
+	var nilFilter *LogFilter
+	if nilFilter.String() != "" {
+		t.Errorf("a nil filter should stringify to empty")
+	}
+}
+
+func lengthPrefixed(parts ...string) []byte {
+	var out []byte
+	for _, p := range parts {
+		var lenBuf [4]byte
+		binary.BigEndian.PutUint32(lenBuf[:], uint32(len(p)))
+		out = append(out, lenBuf[:]...)
+		out = append(out, p...)
+	}
+	return out
+}
+
+func TestSplitLengthPrefixedFrames(t *testing.T) {
+	payload := lengthPrefixed("first\nline", "second")
+	frames, err := splitLengthPrefixedFrames(payload)
+	if err != nil {
+		t.Fatalf("splitLengthPrefixedFrames: %v", err)
+	}
+	if len(frames) != 2 || string(frames[0]) != "first\nline" || string(frames[1]) != "second" {
+		t.Fatalf("got %v, want [first\\nline second]", frames)
+	}
+}
+
+func TestSplitLengthPrefixedFramesEmpty(t *testing.T) {
+	frames, err := splitLengthPrefixedFrames(nil)
+	if err != nil || frames != nil {
+		t.Fatalf("splitLengthPrefixedFrames(nil) = %v, %v; want nil, nil", frames, err)
+	}
+}
+
+func TestSplitLengthPrefixedFramesTruncatedLength(t *testing.T) {
+	if _, err := splitLengthPrefixedFrames([]byte{0, 0, 0}); err == nil {
+		t.Fatalf("expected error for a truncated length prefix")
+	}
+}
+
+func TestSplitLengthPrefixedFramesTruncatedBody(t *testing.T) {
+	var lenBuf [4]byte
+	binary.BigEndian.PutUint32(lenBuf[:], 10)
+	payload := append(lenBuf[:], "short"...)
+	if _, err := splitLengthPrefixedFrames(payload); err == nil {
+		t.Fatalf("expected error for a truncated frame body")
+	}
+}
+
+func TestParseStructuredLineJSON(t *testing.T) {
+	line := parseStructuredLine(`{"lvl":"warn","msg":"disk low","module":"chain","free_gb":"3"}`)
+	if line.Level != "warn" || line.Message != "disk low" || line.Module != "chain" {
+		t.Fatalf("got %+v", line)
+	}
+	if line.Fields["free_gb"] != "3" {
+		t.Errorf("expected free_gb field to be preserved, got %+v", line.Fields)
+	}
+}
+
+func TestParseStructuredLineLog15Style(t *testing.T) {
+	line := parseStructuredLine(`WARN[01-02|03:04:05.678] disk getting full module=chain free_gb="3 GB"`)
+	if line.Level != "WARN" {
+		t.Fatalf("Level = %q, want WARN", line.Level)
+	}
+	if line.Timestamp.Month() != 1 || line.Timestamp.Day() != 2 || line.Timestamp.Hour() != 3 || line.Timestamp.Minute() != 4 || line.Timestamp.Second() != 5 {
+		t.Fatalf("Timestamp not parsed from bracketed token, got %v", line.Timestamp)
+	}
+	if line.Module != "chain" {
+		t.Errorf("Module = %q, want chain", line.Module)
+	}
+	if line.Fields["free_gb"] != "3 GB" {
+		t.Errorf("expected quoted field value to be unquoted, got %+v", line.Fields)
+	}
+}
+
+func TestParseStructuredLineLog15StyleFiltersByTimeRange(t *testing.T) {
+	line := parseStructuredLine(`WARN[01-02|03:04:05.678] disk getting full module=chain`)
+	from := time.Date(line.Timestamp.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	f := &LogFilter{From: from}
+	if !f.Matches(line) {
+		t.Fatalf("expected a parsed log15 timestamp to satisfy a from= filter, got %+v", line)
+	}
+}
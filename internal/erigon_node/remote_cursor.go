@@ -0,0 +1,159 @@
+package erigon_node
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// remoteCursorBatchSize is the number of table rows fetched from the node per
+// /db/read round-trip.
+const remoteCursorBatchSize = 10000
+
+// NodeClientReader is the remote-fetch surface RemoteCursor needs from a
+// connected node: issue a request and split a SUCCESS-framed response into its
+// result lines. It is implemented by the node request pump and, in tests, by
+// mockNodeClientReader.
+type NodeClientReader interface {
+	fetch(url string) (bool, string)
+	getResultLines(result string) ([]string, error)
+}
+
+type remoteCursorEntry struct {
+	key   []byte
+	value []byte
+}
+
+// RemoteCursor iterates a remote MDBX table page by page over the diagnostics
+// protocol, in key order, fetching remoteCursorBatchSize rows per round-trip.
+type RemoteCursor struct {
+	remoteApi NodeClientReader
+
+	dbPath string
+	table  string
+
+	batch    []remoteCursorEntry
+	batchPos int
+	nextKey  []byte
+	done     bool
+}
+
+// NewRemoteCursor creates a RemoteCursor that fetches through remoteApi.
+func NewRemoteCursor(remoteApi NodeClientReader) *RemoteCursor {
+	return &RemoteCursor{remoteApi: remoteApi}
+}
+
+// Init resolves db (the short name the node registered it under) to its full
+// path and loads the first page of table starting at startKey (nil to start
+// from the beginning of the table).
+func (rc *RemoteCursor) Init(ctx context.Context, db, table string, startKey []byte) error {
+	ok, result := rc.remoteApi.fetch("dbs")
+	if !ok {
+		return fmt.Errorf("listing dbs: %s", result)
+	}
+	paths, err := rc.remoteApi.getResultLines(result)
+	if err != nil {
+		return fmt.Errorf("listing dbs: %w", err)
+	}
+	var dbPath string
+	for _, p := range paths {
+		if p == db || strings.HasSuffix(p, "/"+db) {
+			dbPath = p
+			break
+		}
+	}
+	if dbPath == "" {
+		return fmt.Errorf("db %q not found", db)
+	}
+	rc.dbPath = dbPath
+	rc.table = table
+	rc.nextKey = startKey
+	return rc.fetchPage(ctx)
+}
+
+// Token returns the key the cursor would resume from if interrupted now, so a
+// long scan can restart from where it left off instead of from the beginning.
+func (rc *RemoteCursor) Token() []byte {
+	if rc.batchPos < len(rc.batch) {
+		return rc.batch[rc.batchPos].key
+	}
+	return rc.nextKey
+}
+
+func (rc *RemoteCursor) fetchPage(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+	url := fmt.Sprintf("/db/read?path=%s&table=%s&key=%x\n", rc.dbPath, rc.table, rc.nextKey)
+	ok, result := rc.remoteApi.fetch(url)
+	if !ok {
+		return fmt.Errorf("reading table %s: %s", rc.table, result)
+	}
+	lines, err := rc.remoteApi.getResultLines(result)
+	if err != nil {
+		return fmt.Errorf("reading table %s: %w", rc.table, err)
+	}
+	batch := make([]remoteCursorEntry, 0, len(lines))
+	for _, l := range lines {
+		terms := strings.SplitN(l, " | ", 2)
+		if len(terms) != 2 {
+			return fmt.Errorf("malformed table line: %q", l)
+		}
+		key, err := hex.DecodeString(terms[0])
+		if err != nil {
+			return fmt.Errorf("decoding key %q: %w", terms[0], err)
+		}
+		value, err := hex.DecodeString(terms[1])
+		if err != nil {
+			return fmt.Errorf("decoding value %q: %w", terms[1], err)
+		}
+		batch = append(batch, remoteCursorEntry{key: key, value: value})
+	}
+	rc.batch = batch
+	rc.batchPos = 0
+	rc.done = len(lines) < remoteCursorBatchSize
+	if len(batch) > 0 {
+		rc.nextKey = incrementKey(batch[len(batch)-1].key)
+	}
+	return nil
+}
+
+// Next returns the next (key, value) entry in the table, fetching another page
+// from the node once the current one is exhausted. ok is false once the table
+// has been fully consumed.
+func (rc *RemoteCursor) Next(ctx context.Context) (key, value []byte, ok bool, err error) {
+	for rc.batchPos >= len(rc.batch) {
+		if rc.done {
+			return nil, nil, false, nil
+		}
+		if err := rc.fetchPage(ctx); err != nil {
+			return nil, nil, false, err
+		}
+		if len(rc.batch) == 0 {
+			return nil, nil, false, nil
+		}
+	}
+	e := rc.batch[rc.batchPos]
+	rc.batchPos++
+	return e.key, e.value, true, nil
+}
+
+// incrementKey returns the next byte string of the same length as key, used
+// to page past the last row of a fetched batch. Longer keys that have key as a
+// prefix sort before that result and are skipped. If every byte of key is 0xFF,
+// there's no same-length successor, so it returns key with a 0x00 byte
+// appended - the smallest string that has key as a strict prefix, and hence
+// the smallest string greater than key.
+func incrementKey(key []byte) []byte {
+	next := append([]byte(nil), key...)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			return next
+		}
+	}
+	return append(append([]byte(nil), key...), 0)
+}
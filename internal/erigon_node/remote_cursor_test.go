@@ -0,0 +1,29 @@
+package erigon_node
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIncrementKey(t *testing.T) {
+	cases := []struct {
+		name string
+		key  []byte
+		want []byte
+	}{
+		{"simple increment", []byte{0x01, 0x02}, []byte{0x01, 0x03}},
+		{"carries into previous byte", []byte{0x01, 0xFF}, []byte{0x02, 0x00}},
+		{"all 0xFF appends a zero byte", []byte{0xFF, 0xFF, 0xFF}, []byte{0xFF, 0xFF, 0xFF, 0x00}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			original := append([]byte(nil), tc.key...)
+			got := incrementKey(tc.key)
+			require.Equal(t, tc.want, got)
+			require.Equal(t, original, tc.key, "incrementKey must not mutate its argument")
+			require.Equal(t, 1, bytes.Compare(got, tc.key), "incrementKey result must sort strictly after key")
+		})
+	}
+}
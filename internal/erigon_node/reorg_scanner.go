@@ -0,0 +1,205 @@
+package erigon_node
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// ReorgCandidate is a block number for which more than one header hash was
+// observed in the Headers table, together with whichever of those hashes the
+// node currently considers canonical, if known.
+type ReorgCandidate struct {
+	BlockNum      uint64   `json:"blockNum"`
+	Hashes        []string `json:"hashes"`
+	CanonicalHash string   `json:"canonicalHash,omitempty"`
+}
+
+// ReorgReport is the final JSON result of a /reorgs/scan run.
+type ReorgReport struct {
+	From        uint64           `json:"from"`
+	To          uint64           `json:"to"`
+	Candidates  []ReorgCandidate `json:"candidates"`
+	Errors      []string         `json:"errors,omitempty"`
+	ResumeToken string           `json:"resumeToken,omitempty"`
+}
+
+// ReorgProgress is streamed to the client as a scan makes headway, so a scan
+// over a wide block range doesn't leave the operator staring at a blank page.
+type ReorgProgress struct {
+	BlocksScanned int    `json:"blocksScanned"`
+	ResumeToken   string `json:"resumeToken"`
+}
+
+// ReorgScanner detects candidate reorgs: block numbers for which the Headers
+// table records more than one header hash. Each candidate is reported together
+// with the hash HeaderCanonical holds for that number; blocks with a single
+// recorded hash are not checked against HeaderCanonical.
+type ReorgScanner struct {
+	remoteApi NodeClientReader
+}
+
+// NewReorgScanner creates a ReorgScanner that reads through remoteApi.
+func NewReorgScanner(remoteApi NodeClientReader) *ReorgScanner {
+	return &ReorgScanner{remoteApi: remoteApi}
+}
+
+// Scan walks the Headers table of db between block numbers from and to
+// (resuming from resumeToken if non-nil), calling onProgress every
+// remoteCursorBatchSize rows, and returns the final report.
+func (s *ReorgScanner) Scan(ctx context.Context, db string, from, to uint64, resumeToken []byte, onProgress func(ReorgProgress)) (*ReorgReport, error) {
+	headersStart := resumeToken
+	if headersStart == nil {
+		headersStart = blockKey(from)
+	}
+	// A resumeToken is always a full Headers key, so its first 8 bytes are the
+	// block number to resume HeaderCanonical from too - otherwise a resumed
+	// scan would silently re-read the canonical range from scratch.
+	canonicalStart := blockKey(from)
+	if len(resumeToken) >= 8 {
+		canonicalStart = append([]byte(nil), resumeToken[:8]...)
+	}
+
+	headers := NewRemoteCursor(s.remoteApi)
+	if err := headers.Init(ctx, db, "Headers", headersStart); err != nil {
+		return nil, fmt.Errorf("opening Headers cursor: %w", err)
+	}
+	canonical := NewRemoteCursor(s.remoteApi)
+	if err := canonical.Init(ctx, db, "HeaderCanonical", canonicalStart); err != nil {
+		return nil, fmt.Errorf("opening HeaderCanonical cursor: %w", err)
+	}
+
+	report := &ReorgReport{From: from, To: to}
+	byBlock := make(map[uint64][]string)
+	scanned := 0
+	var lastBlockNum uint64
+	haveLast := false
+	pendingResume := false
+	for {
+		key, _, ok, err := headers.Next(ctx)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			break
+		}
+		if !ok {
+			break
+		}
+		if len(key) < 40 {
+			report.Errors = append(report.Errors, fmt.Sprintf("short header key: %x", key))
+			continue
+		}
+		blockNum := binary.BigEndian.Uint64(key[:8])
+		if blockNum > to {
+			break
+		}
+
+		// Only take a resume snapshot once we've moved past the block that
+		// crossed the remoteCursorBatchSize threshold, so a resumed scan
+		// never starts mid-block and byBlock is never missing the entries a
+		// previous call already saw for that block.
+		if pendingResume && (!haveLast || blockNum != lastBlockNum) {
+			if onProgress != nil {
+				onProgress(ReorgProgress{BlocksScanned: scanned, ResumeToken: hex.EncodeToString(key)})
+			}
+			pendingResume = false
+		}
+
+		byBlock[blockNum] = append(byBlock[blockNum], hex.EncodeToString(key[8:40]))
+		scanned++
+		lastBlockNum = blockNum
+		haveLast = true
+		if onProgress != nil && scanned%remoteCursorBatchSize == 0 {
+			pendingResume = true
+		}
+	}
+
+	canonicalHash := make(map[uint64]string)
+	for {
+		key, value, ok, err := canonical.Next(ctx)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			break
+		}
+		if !ok {
+			break
+		}
+		if len(key) < 8 {
+			continue
+		}
+		blockNum := binary.BigEndian.Uint64(key[:8])
+		if blockNum > to {
+			break
+		}
+		canonicalHash[blockNum] = hex.EncodeToString(value)
+	}
+
+	for blockNum, hashes := range byBlock {
+		if len(hashes) < 2 {
+			continue
+		}
+		report.Candidates = append(report.Candidates, ReorgCandidate{
+			BlockNum:      blockNum,
+			Hashes:        hashes,
+			CanonicalHash: canonicalHash[blockNum],
+		})
+	}
+	report.ResumeToken = hex.EncodeToString(headers.Token())
+	return report, nil
+}
+
+func blockKey(blockNum uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, blockNum)
+	return key
+}
+
+// HandleReorgScan serves GET /reorgs/scan?from=&to=[&resume=], streaming an SSE
+// "progress" event after every batch of remoteCursorBatchSize rows and a final
+// "report" event carrying the full JSON ReorgReport, so a long scan streams
+// incremental updates instead of blocking the whole HTTP response.
+func (s *ReorgScanner) HandleReorgScan(w http.ResponseWriter, r *http.Request, db string) {
+	from, err := strconv.ParseUint(r.URL.Query().Get("from"), 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid from: %v", err), http.StatusBadRequest)
+		return
+	}
+	to, err := strconv.ParseUint(r.URL.Query().Get("to"), 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid to: %v", err), http.StatusBadRequest)
+		return
+	}
+	var resumeToken []byte
+	if resume := r.URL.Query().Get("resume"); resume != "" {
+		resumeToken, err = hex.DecodeString(resume)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid resume token: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+
+	report, err := s.Scan(r.Context(), db, from, to, resumeToken, func(p ReorgProgress) {
+		data, _ := json.Marshal(p)
+		fmt.Fprintf(w, "event: progress\ndata: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	})
+	if err != nil {
+		fmt.Fprintf(w, "event: error\ndata: %s\n\n", err.Error())
+		return
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		fmt.Fprintf(w, "event: error\ndata: %s\n\n", err.Error())
+		return
+	}
+	fmt.Fprintf(w, "event: report\ndata: %s\n\n", data)
+}
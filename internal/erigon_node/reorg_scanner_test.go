@@ -0,0 +1,217 @@
+package erigon_node
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockNodeClientReader struct {
+	mock.Mock
+}
+
+func (m *mockNodeClientReader) fetch(url string) (bool, string) {
+	args := m.Called(url)
+	return args.Bool(0), args.String(1)
+}
+
+func (m *mockNodeClientReader) getResultLines(result string) ([]string, error) {
+	args := m.Called(result)
+	var lines []string
+	if l, ok := args.Get(0).([]string); ok {
+		lines = l
+	}
+	return lines, args.Error(1)
+}
+
+// headerKey builds a Headers table key: 8-byte big-endian block number
+// followed by a 32-byte hash filled with hashByte.
+func headerKey(blockNum uint64, hashByte byte) []byte {
+	key := append([]byte(nil), blockKey(blockNum)...)
+	for i := 0; i < 32; i++ {
+		key = append(key, hashByte)
+	}
+	return key
+}
+
+func readURL(dbPath, table string, key []byte) string {
+	return fmt.Sprintf("/db/read?path=%s&table=%s&key=%s\n", dbPath, table, hex.EncodeToString(key))
+}
+
+func TestReorgScannerScanFindsCandidateAndCanonicalHash(t *testing.T) {
+	const (
+		db     = "testDb"
+		dbPath = "/full/path/testDb"
+	)
+	remoteApi := &mockNodeClientReader{}
+	dbListResult := fmt.Sprintf("SUCCESS\n%s", dbPath)
+	remoteApi.On("fetch", "dbs").Return(true, dbListResult)
+	remoteApi.On("getResultLines", dbListResult).Return([]string{dbPath}, nil)
+
+	lineA := fmt.Sprintf("%s | %s", hex.EncodeToString(headerKey(1, 0xaa)), hex.EncodeToString([]byte("header-a")))
+	lineB := fmt.Sprintf("%s | %s", hex.EncodeToString(headerKey(1, 0xbb)), hex.EncodeToString([]byte("header-b")))
+	headersResult := fmt.Sprintf("SUCCESS\n%s\n%s", lineA, lineB)
+	remoteApi.On("fetch", readURL(dbPath, "Headers", blockKey(1))).Return(true, headersResult).Once()
+	remoteApi.On("getResultLines", headersResult).Return([]string{lineA, lineB}, nil).Once()
+
+	canonicalLine := fmt.Sprintf("%s | %s", hex.EncodeToString(blockKey(1)), hex.EncodeToString(headerKey(1, 0xaa)[8:]))
+	canonicalResult := fmt.Sprintf("SUCCESS\n%s", canonicalLine)
+	remoteApi.On("fetch", readURL(dbPath, "HeaderCanonical", blockKey(1))).Return(true, canonicalResult).Once()
+	remoteApi.On("getResultLines", canonicalResult).Return([]string{canonicalLine}, nil).Once()
+
+	scanner := NewReorgScanner(remoteApi)
+	report, err := scanner.Scan(context.Background(), db, 1, 10, nil, nil)
+	require.NoError(t, err)
+	require.Empty(t, report.Errors)
+	require.Len(t, report.Candidates, 1)
+	require.Equal(t, uint64(1), report.Candidates[0].BlockNum)
+	require.ElementsMatch(t, []string{hex.EncodeToString(headerKey(1, 0xaa)[8:]), hex.EncodeToString(headerKey(1, 0xbb)[8:])}, report.Candidates[0].Hashes)
+	require.Equal(t, hex.EncodeToString(headerKey(1, 0xaa)[8:]), report.Candidates[0].CanonicalHash)
+}
+
+func TestReorgScannerScanResumeReSeedsBothCursors(t *testing.T) {
+	const (
+		db     = "testDb"
+		dbPath = "/full/path/testDb"
+	)
+	remoteApi := &mockNodeClientReader{}
+	dbListResult := fmt.Sprintf("SUCCESS\n%s", dbPath)
+	remoteApi.On("fetch", "dbs").Return(true, dbListResult)
+	remoteApi.On("getResultLines", dbListResult).Return([]string{dbPath}, nil)
+
+	resumeKey := headerKey(5, 0xaa)
+	line := fmt.Sprintf("%s | %s", hex.EncodeToString(resumeKey), hex.EncodeToString([]byte("header-5")))
+	headersResult := fmt.Sprintf("SUCCESS\n%s", line)
+	remoteApi.On("fetch", readURL(dbPath, "Headers", resumeKey)).Return(true, headersResult).Once()
+	remoteApi.On("getResultLines", headersResult).Return([]string{line}, nil).Once()
+
+	canonicalResult := "SUCCESS\n"
+	// A resumed scan must seed HeaderCanonical at the resume token's block
+	// number (5), not blockKey(from) - this is the call the pre-fix code
+	// never made.
+	remoteApi.On("fetch", readURL(dbPath, "HeaderCanonical", blockKey(5))).Return(true, canonicalResult).Once()
+	remoteApi.On("getResultLines", canonicalResult).Return(nil, nil).Once()
+
+	scanner := NewReorgScanner(remoteApi)
+	_, err := scanner.Scan(context.Background(), db, 1, 10, resumeKey, nil)
+	require.NoError(t, err)
+	remoteApi.AssertExpectations(t)
+}
+
+// TestReorgScannerScanDefersResumeAcrossAPageThatSplitsABlock builds exactly
+// remoteCursorBatchSize Headers rows so the first page boundary falls right
+// on the first of two entries for the same block number, then confirms both
+// entries are still captured as one reorg candidate and that the resume
+// token emitted once the next block starts points past the split block
+// rather than into the middle of it.
+func TestReorgScannerScanDefersResumeAcrossAPageThatSplitsABlock(t *testing.T) {
+	const (
+		db     = "testDb"
+		dbPath = "/full/path/testDb"
+	)
+	remoteApi := &mockNodeClientReader{}
+	dbListResult := fmt.Sprintf("SUCCESS\n%s", dbPath)
+	remoteApi.On("fetch", "dbs").Return(true, dbListResult)
+	remoteApi.On("getResultLines", dbListResult).Return([]string{dbPath}, nil)
+
+	splitBlock := uint64(10000)
+	page1Lines := make([]string, 0, remoteCursorBatchSize)
+	for b := uint64(1); b < splitBlock; b++ {
+		page1Lines = append(page1Lines, fmt.Sprintf("%s | %s", hex.EncodeToString(headerKey(b, 0x01)), hex.EncodeToString([]byte("header"))))
+	}
+	splitEntry1Key := headerKey(splitBlock, 0xaa)
+	page1Lines = append(page1Lines, fmt.Sprintf("%s | %s", hex.EncodeToString(splitEntry1Key), hex.EncodeToString([]byte("header-split-a"))))
+	page1Result := "SUCCESS\n" + joinLines(page1Lines)
+	remoteApi.On("fetch", readURL(dbPath, "Headers", blockKey(1))).Return(true, page1Result).Once()
+	remoteApi.On("getResultLines", page1Result).Return(page1Lines, nil).Once()
+
+	page2StartKey := incrementKey(splitEntry1Key)
+	splitEntry2Key := headerKey(splitBlock, 0xbb)
+	nextBlock := splitBlock + 1
+	nextBlockKey := headerKey(nextBlock, 0x01)
+	page2Line1 := fmt.Sprintf("%s | %s", hex.EncodeToString(splitEntry2Key), hex.EncodeToString([]byte("header-split-b")))
+	page2Line2 := fmt.Sprintf("%s | %s", hex.EncodeToString(nextBlockKey), hex.EncodeToString([]byte("header-next")))
+	page2Result := "SUCCESS\n" + page2Line1 + "\n" + page2Line2
+	remoteApi.On("fetch", readURL(dbPath, "Headers", page2StartKey)).Return(true, page2Result).Once()
+	remoteApi.On("getResultLines", page2Result).Return([]string{page2Line1, page2Line2}, nil).Once()
+
+	canonicalResult := "SUCCESS\n"
+	remoteApi.On("fetch", readURL(dbPath, "HeaderCanonical", blockKey(1))).Return(true, canonicalResult).Once()
+	remoteApi.On("getResultLines", canonicalResult).Return(nil, nil).Once()
+
+	scanner := NewReorgScanner(remoteApi)
+	var progress []ReorgProgress
+	report, err := scanner.Scan(context.Background(), db, 1, nextBlock, nil, func(p ReorgProgress) {
+		progress = append(progress, p)
+	})
+	require.NoError(t, err)
+	require.Len(t, report.Candidates, 1)
+	require.Equal(t, splitBlock, report.Candidates[0].BlockNum)
+	require.ElementsMatch(t, []string{hex.EncodeToString(splitEntry1Key[8:]), hex.EncodeToString(splitEntry2Key[8:])}, report.Candidates[0].Hashes)
+
+	require.Len(t, progress, 1, "the batch-size threshold is only crossed once, right on the split block's first entry")
+	resumeKeyBytes, err := hex.DecodeString(progress[0].ResumeToken)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, len(resumeKeyBytes), 8)
+	require.Equal(t, nextBlock, binary.BigEndian.Uint64(resumeKeyBytes[:8]), "resume token must point past the split block, never into the middle of it")
+}
+
+func joinLines(lines []string) string {
+	out := ""
+	for i, l := range lines {
+		if i > 0 {
+			out += "\n"
+		}
+		out += l
+	}
+	return out
+}
+
+func TestHandleReorgScanStreamsProgressAndReport(t *testing.T) {
+	const (
+		db     = "testDb"
+		dbPath = "/full/path/testDb"
+	)
+	remoteApi := &mockNodeClientReader{}
+	dbListResult := fmt.Sprintf("SUCCESS\n%s", dbPath)
+	remoteApi.On("fetch", "dbs").Return(true, dbListResult)
+	remoteApi.On("getResultLines", dbListResult).Return([]string{dbPath}, nil)
+
+	line := fmt.Sprintf("%s | %s", hex.EncodeToString(headerKey(1, 0xaa)), hex.EncodeToString([]byte("header-1")))
+	headersResult := fmt.Sprintf("SUCCESS\n%s", line)
+	remoteApi.On("fetch", readURL(dbPath, "Headers", blockKey(1))).Return(true, headersResult).Once()
+	remoteApi.On("getResultLines", headersResult).Return([]string{line}, nil).Once()
+
+	canonicalResult := "SUCCESS\n"
+	remoteApi.On("fetch", readURL(dbPath, "HeaderCanonical", blockKey(1))).Return(true, canonicalResult).Once()
+	remoteApi.On("getResultLines", canonicalResult).Return(nil, nil).Once()
+
+	scanner := NewReorgScanner(remoteApi)
+	req := httptest.NewRequest("GET", "/reorgs/scan?from=1&to=10", nil)
+	w := httptest.NewRecorder()
+
+	scanner.HandleReorgScan(w, req, db)
+
+	resp := w.Result()
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	body := w.Body.String()
+	require.Contains(t, body, "event: report")
+	require.Contains(t, body, `"from":1`)
+	require.Contains(t, body, `"to":10`)
+}
+
+func TestHandleReorgScanInvalidRangeReturnsBadRequest(t *testing.T) {
+	scanner := NewReorgScanner(&mockNodeClientReader{})
+	req := httptest.NewRequest("GET", "/reorgs/scan?from=notanumber&to=10", nil)
+	w := httptest.NewRecorder()
+
+	scanner.HandleReorgScan(w, req, "testDb")
+
+	require.Equal(t, 400, w.Result().StatusCode)
+}